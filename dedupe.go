@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sentRunsCollection records every (run, webhook) pair an embed has been
+// delivered for, so a speedrun.com redelivery of the same run doesn't send
+// it twice. Documents expire after 30 days via a TTL index, which is well
+// past the window speedrun.com has been observed to redeliver in.
+const sentRunsCollection = "sent-runs"
+
+const sentRunTTL = 30 * 24 * time.Hour
+
+// sentRun is the document stored in sentRunsCollection per delivery.
+type sentRun struct {
+	RunID      string    `bson:"runID"`
+	WebhookURL string    `bson:"webhookURL"`
+	SentAt     time.Time `bson:"sentAt"`
+}
+
+// Dedupe is a two-layer "have we already sent this?" check: an in-memory
+// Bloom filter for an O(1) negative lookup, backed by sentRunsCollection for
+// authoritative confirmation on Bloom positives (Bloom filters never false
+// negative, only false positive).
+type Dedupe struct {
+	mu     sync.Mutex
+	filter *bloom.BloomFilter
+}
+
+func NewDedupe() *Dedupe {
+	return &Dedupe{filter: bloom.NewWithEstimates(100000, 0.001)}
+}
+
+func dedupeKey(runID, webhookUrl string) string {
+	return runID + "|" + webhookUrl
+}
+
+// LoadFromMongo replays sentRunsCollection into a fresh Bloom filter. It's
+// called once at startup, and again from the /api/RebuildBloom admin
+// endpoint if the filter is ever suspected to have drifted.
+func (d *Dedupe) LoadFromMongo(ctx context.Context) error {
+	sentRunsColl := mongoClient.Database(database).Collection(sentRunsCollection)
+	cur, err := sentRunsColl.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("finding sent runs: %w", err)
+	}
+	defer cur.Close(ctx)
+	filter := bloom.NewWithEstimates(100000, 0.001)
+	for cur.Next(ctx) {
+		var result sentRun
+		if err := cur.Decode(&result); err != nil {
+			return fmt.Errorf("decoding sent run: %w", err)
+		}
+		filter.AddString(dedupeKey(result.RunID, result.WebhookURL))
+	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("iterating sent runs: %w", err)
+	}
+	d.mu.Lock()
+	d.filter = filter
+	d.mu.Unlock()
+	return nil
+}
+
+// AlreadySent reports whether runID has already been delivered to
+// webhookUrl. A Bloom positive is confirmed against Mongo before being
+// trusted, since the filter can false-positive. If Mongo can't be reached,
+// it fails closed (treats the run as already sent) to avoid double-posting.
+func (d *Dedupe) AlreadySent(ctx context.Context, runID, webhookUrl string) bool {
+	d.mu.Lock()
+	maybeSent := d.filter.TestString(dedupeKey(runID, webhookUrl))
+	d.mu.Unlock()
+	if !maybeSent {
+		return false
+	}
+	sentRunsColl := mongoClient.Database(database).Collection(sentRunsCollection)
+	count, err := sentRunsColl.CountDocuments(ctx, bson.M{"runID": runID, "webhookURL": webhookUrl})
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"run_id": runID, "webhook_url": webhookUrl}).Error("confirming dedupe hit in Mongo")
+		return true
+	}
+	return count > 0
+}
+
+// MarkSent records a successful delivery so a redelivery of the same run is
+// suppressed. It should only be called after a 2xx response from Discord.
+func (d *Dedupe) MarkSent(ctx context.Context, runID, webhookUrl string) {
+	d.mu.Lock()
+	d.filter.AddString(dedupeKey(runID, webhookUrl))
+	d.mu.Unlock()
+	sentRunsColl := mongoClient.Database(database).Collection(sentRunsCollection)
+	if _, err := sentRunsColl.InsertOne(ctx, sentRun{RunID: runID, WebhookURL: webhookUrl, SentAt: time.Now()}); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"run_id": runID, "webhook_url": webhookUrl}).Error("recording sent run")
+	}
+}
+
+// EnsureSentRunsIndexes creates the TTL index expiring sent-run records
+// after sentRunTTL. It's safe to call on every startup.
+func EnsureSentRunsIndexes(ctx context.Context) error {
+	sentRunsColl := mongoClient.Database(database).Collection(sentRunsCollection)
+	_, err := sentRunsColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "sentAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(sentRunTTL.Seconds())),
+	})
+	return err
+}
+
+// rebuildBloomHandler is an admin endpoint for rebuilding the in-memory
+// Bloom filter from Mongo without restarting the process.
+func rebuildBloomHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*30)
+	defer cancel()
+	if err := dedupe.LoadFromMongo(ctx); err != nil {
+		logrus.WithError(err).Error("rebuilding bloom filter")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,138 @@
+// Package discord provides typed builders for the Discord webhook execute
+// payload (embeds, components, allowed mentions) so callers don't have to
+// hand-assemble map[string]interface{} bodies.
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Component types, per Discord's message components API.
+const (
+	ComponentTypeActionRow = 1
+	ComponentTypeButton    = 2
+)
+
+// ButtonStyleLink is the only button style that doesn't require an
+// interaction handler, since it just opens a URL.
+const ButtonStyleLink = 5
+
+type EmbedAuthor struct {
+	Name    string `json:"name,omitempty"`
+	URL     string `json:"url,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type EmbedFooter struct {
+	Text    string `json:"text,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type EmbedThumbnail struct {
+	URL string `json:"url,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type Embed struct {
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	URL         string          `json:"url,omitempty"`
+	Color       int             `json:"color,omitempty"`
+	Author      *EmbedAuthor    `json:"author,omitempty"`
+	Footer      *EmbedFooter    `json:"footer,omitempty"`
+	Thumbnail   *EmbedThumbnail `json:"thumbnail,omitempty"`
+	Fields      []EmbedField    `json:"fields,omitempty"`
+}
+
+// PrependField inserts a field at the front, mirroring the ordering the
+// embeds used before fields were built up incrementally (level, players,
+// category, time, variables).
+func (e *Embed) PrependField(field EmbedField) {
+	e.Fields = append([]EmbedField{field}, e.Fields...)
+}
+
+type ComponentButton struct {
+	Type  int    `json:"type"`
+	Style int    `json:"style,omitempty"`
+	Label string `json:"label"`
+	URL   string `json:"url,omitempty"`
+}
+
+type ComponentRow struct {
+	Type       int               `json:"type"`
+	Components []ComponentButton `json:"components"`
+}
+
+// LinkButtons builds a single action row of link buttons, skipping any
+// label whose URL is empty (e.g. a run with no video submitted).
+func LinkButtons(links ...ComponentButton) ComponentRow {
+	row := ComponentRow{Type: ComponentTypeActionRow}
+	for _, button := range links {
+		if button.URL == "" {
+			continue
+		}
+		button.Type = ComponentTypeButton
+		button.Style = ButtonStyleLink
+		row.Components = append(row.Components, button)
+	}
+	return row
+}
+
+// AllowedMentions controls which mentions in Content are actually allowed to
+// ping. Discord treats a missing allowed_mentions as "mention everything
+// the content references", so every Message defaults to the empty parse
+// list below to avoid surprise pings.
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// DefaultAllowedMentions returns the "mention nobody" default. It's a
+// function rather than a package-level var so callers each get their own
+// slice to append to.
+func DefaultAllowedMentions() *AllowedMentions {
+	return &AllowedMentions{Parse: []string{}}
+}
+
+// Message is the top-level body of a Discord webhook execute request.
+type Message struct {
+	Content         string           `json:"content,omitempty"`
+	Embeds          []Embed          `json:"embeds,omitempty"`
+	Components      []ComponentRow   `json:"components,omitempty"`
+	AllowedMentions *AllowedMentions `json:"allowed_mentions,omitempty"`
+	Attachments     []interface{}    `json:"attachments"`
+}
+
+// NewMessage returns a Message with the allowed_mentions lockdown default
+// applied; callers can override it per-webhook before sending.
+func NewMessage() *Message {
+	return &Message{AllowedMentions: DefaultAllowedMentions()}
+}
+
+// SetContentWithRoleMention renders template, substituting {{role}} with a
+// mention for roleID, and whitelists roleID in AllowedMentions so the
+// mention actually pings instead of rendering inert.
+func (m *Message) SetContentWithRoleMention(template, roleID string) {
+	if roleID == "" {
+		m.Content = template
+		return
+	}
+	m.Content = strings.ReplaceAll(template, "{{role}}", fmt.Sprintf("<@&%v>", roleID))
+	if m.AllowedMentions == nil {
+		m.AllowedMentions = DefaultAllowedMentions()
+	}
+	m.AllowedMentions.Roles = append(m.AllowedMentions.Roles, roleID)
+}
+
+// Marshal renders the message as the JSON body a Discord webhook expects.
+func (m *Message) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -0,0 +1,102 @@
+package discord
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewMessageDefaultsToNoMentions(t *testing.T) {
+	msg := NewMessage()
+	body, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal returned an error: %v", err)
+	}
+	if !strings.Contains(string(body), `"allowed_mentions":{"parse":[]}`) {
+		t.Fatalf("expected default allowed_mentions to lock out all pings, got %s", body)
+	}
+}
+
+func TestLinkButtonsSkipsEmptyURLs(t *testing.T) {
+	row := LinkButtons(
+		ComponentButton{Label: "Watch VOD", URL: "https://example.com/vod"},
+		ComponentButton{Label: "View Run", URL: ""},
+		ComponentButton{Label: "Leaderboard", URL: "https://example.com/board"},
+	)
+	if row.Type != ComponentTypeActionRow {
+		t.Fatalf("expected action row type %d, got %d", ComponentTypeActionRow, row.Type)
+	}
+	if len(row.Components) != 2 {
+		t.Fatalf("expected 2 buttons after skipping the empty URL, got %d", len(row.Components))
+	}
+	for _, button := range row.Components {
+		if button.Type != ComponentTypeButton || button.Style != ButtonStyleLink {
+			t.Fatalf("expected every button to be a type %d style %d link button, got type %d style %d", ComponentTypeButton, ButtonStyleLink, button.Type, button.Style)
+		}
+	}
+}
+
+func TestSetContentWithRoleMentionWhitelistsRole(t *testing.T) {
+	msg := NewMessage()
+	msg.SetContentWithRoleMention("{{role}} new world record!", "123456789")
+	if msg.Content != "<@&123456789> new world record!" {
+		t.Fatalf("expected role mention substitution, got %q", msg.Content)
+	}
+	if len(msg.AllowedMentions.Roles) != 1 || msg.AllowedMentions.Roles[0] != "123456789" {
+		t.Fatalf("expected role to be whitelisted in allowed_mentions, got %+v", msg.AllowedMentions)
+	}
+}
+
+func TestEmbedPrependFieldInsertsAtFront(t *testing.T) {
+	embed := Embed{
+		Fields: []EmbedField{
+			{Name: "Category", Value: "Any%"},
+			{Name: "Time", Value: "1:23"},
+		},
+	}
+	embed.PrependField(EmbedField{Name: "Level", Value: "Bowser's Castle"})
+	if len(embed.Fields) != 3 || embed.Fields[0].Name != "Level" {
+		t.Fatalf("expected Level prepended to the front, got %+v", embed.Fields)
+	}
+	if embed.Fields[1].Name != "Category" || embed.Fields[2].Name != "Time" {
+		t.Fatalf("expected existing fields to keep their order, got %+v", embed.Fields)
+	}
+}
+
+func TestMessageMarshalIncludesThumbnailAndComponents(t *testing.T) {
+	msg := NewMessage()
+	msg.Embeds = []Embed{
+		{
+			Title:     "New world record!",
+			Thumbnail: &EmbedThumbnail{URL: "https://example.com/cover.png"},
+			Fields: []EmbedField{
+				{Name: "Category", Value: "Any%", Inline: true},
+			},
+		},
+	}
+	msg.Components = []ComponentRow{
+		LinkButtons(ComponentButton{Label: "View Run", URL: "https://speedrun.com/run/abc"}),
+	}
+
+	var decoded map[string]interface{}
+	body, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal returned an error: %v", err)
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("marshalled body isn't valid JSON: %v", err)
+	}
+	embeds, ok := decoded["embeds"].([]interface{})
+	if !ok || len(embeds) != 1 {
+		t.Fatalf("expected one embed in the payload, got %+v", decoded["embeds"])
+	}
+	embed := embeds[0].(map[string]interface{})
+	thumbnail, ok := embed["thumbnail"].(map[string]interface{})
+	if !ok || thumbnail["url"] != "https://example.com/cover.png" {
+		t.Fatalf("expected thumbnail to round-trip, got %+v", embed["thumbnail"])
+	}
+	components, ok := decoded["components"].([]interface{})
+	if !ok || len(components) != 1 {
+		t.Fatalf("expected one component row in the payload, got %+v", decoded["components"])
+	}
+}
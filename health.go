@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// healthStatus is the JSON body served by /healthz.
+type healthStatus struct {
+	MongoOK                  bool    `json:"mongo_ok"`
+	SpeedrunComLimiterTokens float64 `json:"speedruncom_limiter_tokens"`
+	DiscordLimiterTokens     float64 `json:"discord_limiter_tokens"`
+}
+
+// healthzHandler reports whether Mongo is reachable and how much headroom
+// is left in the speedrun.com/Discord rate limiters.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+
+	status := healthStatus{
+		SpeedrunComLimiterTokens: cS.limiter.Tokens(),
+		DiscordLimiterTokens:     cD.limiter.Tokens(),
+	}
+	if mongoClient != nil {
+		status.MongoOK = mongoClient.Ping(ctx, nil) == nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.MongoOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
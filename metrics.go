@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// metricsHandler serves Discord delivery queue/retry counts in the
+// Prometheus text exposition format, so operators can see when Discord is
+// throttling deliveries without grepping logs.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP src_webhook_discord_retries_total Total webhook delivery retry attempts after a 429 or 5xx response.")
+	fmt.Fprintln(w, "# TYPE src_webhook_discord_retries_total counter")
+	fmt.Fprintf(w, "src_webhook_discord_retries_total %d\n", atomic.LoadInt64(&cD.retryCount))
+	fmt.Fprintln(w, "# HELP src_webhook_discord_queue_depth Webhook deliveries currently backing off before a retry.")
+	fmt.Fprintln(w, "# TYPE src_webhook_discord_queue_depth gauge")
+	fmt.Fprintf(w, "src_webhook_discord_queue_depth %d\n", atomic.LoadInt64(&cD.queueDepth))
+}
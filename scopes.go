@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SRCStats/src-webhook-sender/discord"
+	"github.com/sirupsen/logrus"
+)
+
+// User is the subset of speedrun.com's /users/{id} response we need to
+// attribute a rejection to the examiner who made it.
+type User struct {
+	Data struct {
+		ID    string `json:"id,omitempty"`
+		Names struct {
+			International string `json:"international,omitempty"`
+		} `json:"names,omitempty"`
+		Weblink string `json:"weblink,omitempty"`
+	} `json:"data,omitempty"`
+}
+
+// GetUser resolves a speedrun.com user ID, e.g. to attribute a rejection to
+// the examiner who made it.
+func GetUser(userID string) User {
+	r, err := cS.Do(createReq(fmt.Sprintf("/users/%v", userID)))
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", userID).Error("getting user")
+		return User{}
+	}
+	return parseResUser(r)
+}
+
+func parseResUser(r *http.Response) User {
+	if r == nil || r.StatusCode == 400 || r.StatusCode == 404 {
+		return User{}
+	}
+	result, err := io.ReadAll(r.Body)
+	if err != nil {
+		logrus.WithError(err).Error("reading user response")
+		return User{}
+	}
+	r.Body.Close()
+	var res User
+	if err := json.Unmarshal(result, &res); err != nil {
+		logrus.WithError(err).Error("unmarshalling user response")
+	}
+	return res
+}
+
+// eventSubscribed reports whether a webhook's Verification.Events opts it
+// into the given scope ("new" or "rejected").
+func eventSubscribed(events []string, scope string) bool {
+	for _, event := range events {
+		if event == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// moderates reports whether any of ids appears in moderators, used to scope
+// "new"/"rejected" notifications to the moderators of the affected game.
+func moderates(ids []string, moderators []string) bool {
+	for _, id := range ids {
+		for _, moderator := range moderators {
+			if id == moderator {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inScope reports whether a webhook's Verification matches run: if Context
+// is set, the run's game must match it, and if IDs is set, one of the
+// webhook's IDs must moderate the run's game. A webhook with neither set
+// matches every run.
+func inScope(webhook Webhook, run Data) bool {
+	if webhook.Verification.Context != "" && webhook.Verification.Context != run.Game.Data.ID {
+		return false
+	}
+	if len(webhook.Verification.IDs) > 0 && !moderates(webhook.Verification.IDs, run.Game.Data.Moderators) {
+		return false
+	}
+	return true
+}
+
+func submitterName(run Data) string {
+	if len(run.Players.Data) == 0 {
+		return "Unknown"
+	}
+	if run.Players.Data[0].Name != "" {
+		return run.Players.Data[0].Name
+	}
+	return run.Players.Data[0].Names.International
+}
+
+// mergeAllowedMentions applies a per-webhook AllowedMentions override while
+// preserving any Roles/Users that msg's AllowedMentions already whitelisted
+// (e.g. via SetContentWithRoleMention), so a webhook's override can't
+// silently clobber a role mention the content template just built.
+func mergeAllowedMentions(override, current *discord.AllowedMentions) *discord.AllowedMentions {
+	if current == nil {
+		return override
+	}
+	merged := *override
+	merged.Roles = mergeMentionIDs(override.Roles, current.Roles)
+	merged.Users = mergeMentionIDs(override.Users, current.Users)
+	return &merged
+}
+
+// mergeMentionIDs combines two ID lists without duplicates.
+func mergeMentionIDs(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var merged []string
+	for _, id := range append(append([]string{}, a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	return merged
+}
+
+// deliverMessage marshals msg, posts it to webhook, and handles the shared
+// post-delivery bookkeeping: dedupe recording on success, webhook deletion
+// on 404, marking the webhook disabled on 401/403, and a log line on 429.
+func deliverMessage(webhook Webhook, runID string, msg *discord.Message) {
+	if webhook.Notification.AllowedMentions != nil {
+		msg.AllowedMentions = mergeAllowedMentions(webhook.Notification.AllowedMentions, msg.AllowedMentions)
+	}
+	body, err := msg.Marshal()
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"run_id": runID, "webhook_url": webhook.WebhookUrl}).Error("marshalling webhook body")
+		return
+	}
+	start := time.Now()
+	res, err := cD.Do(webhook.WebhookUrl, body)
+	latencyMs := time.Since(start).Milliseconds()
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"run_id": runID, "webhook_url": webhook.WebhookUrl, "latency_ms": latencyMs}).Error("sending webhook")
+		return
+	}
+	fields := logrus.Fields{"run_id": runID, "webhook_url": webhook.WebhookUrl, "status_code": res.StatusCode, "latency_ms": latencyMs}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		dedupe.MarkSent(context.Background(), runID, webhook.WebhookUrl)
+		logrus.WithFields(fields).Info("delivered webhook")
+	}
+	if res.StatusCode == 404 {
+		logrus.WithFields(fields).Warn("webhook is not found, deleting it")
+		if err := DeleteWebhook(webhook); err != nil {
+			logrus.WithError(err).WithField("webhook_url", webhook.WebhookUrl).Error("deleting webhook")
+		}
+	}
+	if res.StatusCode == 401 || res.StatusCode == 403 {
+		logrus.WithFields(fields).Warn("webhook auth rejected, disabling it")
+		if err := MarkWebhookDisabled(webhook); err != nil {
+			logrus.WithError(err).WithField("webhook_url", webhook.WebhookUrl).Error("disabling webhook")
+		}
+	}
+	if res.StatusCode == 429 {
+		logrus.WithFields(fields).Warn("webhook is over rate limit")
+	}
+}
+
+// HandleNew notifies moderators of a run newly submitted for verification.
+func HandleNew(data *[]Data, webhooks *[]Webhook) {
+	wg.Add(1)
+	for _, run := range *data {
+		for _, webhook := range *webhooks {
+			if !eventSubscribed(webhook.Verification.Events, "new") || !inScope(webhook, run) {
+				continue
+			}
+			if dedupe.AlreadySent(context.Background(), run.ID, webhook.WebhookUrl) {
+				logrus.WithFields(logrus.Fields{"run_id": run.ID, "webhook_url": webhook.WebhookUrl}).Info("run already sent to webhook, skipping redelivery")
+				continue
+			}
+			wg.Add(1)
+			go SendWebhook(&map[string]Webhook{webhook.WebhookUrl: webhook}, run, "new", User{})
+		}
+	}
+	wg.Done()
+}
+
+// HandleRejected notifies moderators of a run that's been rejected. The
+// examiner who rejected the run is the same for every matching webhook, so
+// it's resolved once per run (mirroring the userPBs cache in SendWebhook's
+// "verified" case) instead of once per webhook.
+func HandleRejected(data *[]Data, webhooks *[]Webhook) {
+	wg.Add(1)
+	for _, run := range *data {
+		webhooksToSend := make(map[string]Webhook)
+		for _, webhook := range *webhooks {
+			if !eventSubscribed(webhook.Verification.Events, "rejected") || !inScope(webhook, run) {
+				continue
+			}
+			if dedupe.AlreadySent(context.Background(), run.ID, webhook.WebhookUrl) {
+				logrus.WithFields(logrus.Fields{"run_id": run.ID, "webhook_url": webhook.WebhookUrl}).Info("run already sent to webhook, skipping redelivery")
+				continue
+			}
+			webhooksToSend[webhook.WebhookUrl] = webhook
+		}
+		if len(webhooksToSend) == 0 {
+			continue
+		}
+		examiner := GetUser(run.Status.Examiner)
+		wg.Add(1)
+		go SendWebhook(&webhooksToSend, run, "rejected", examiner)
+	}
+	wg.Done()
+}
+
+func newRunEmbed(run Data, webhook Webhook) *discord.Message {
+	author := submitterName(run)
+	embed := discord.Embed{
+		Title:       fmt.Sprintf("New run awaiting verification in %v", run.Game.Data.Names.International),
+		Description: fmt.Sprintf("**%v** submitted a new run and it's awaiting verification.", author),
+		Color:       3901635,
+		URL:         run.Weblink,
+		Fields: []discord.EmbedField{
+			{Name: "Submitter", Value: author, Inline: true},
+			{Name: "Category", Value: run.Category.Data.Name, Inline: true},
+			{Name: "Submitted", Value: run.Submitted.Format(time.RFC1123), Inline: true},
+		},
+	}
+	msg := discord.NewMessage()
+	msg.Embeds = []discord.Embed{embed}
+	if webhook.Verification.Templates.New != "" {
+		msg.SetContentWithRoleMention(webhook.Verification.Templates.New, webhook.Notification.MentionRoleID)
+	}
+	return msg
+}
+
+func rejectedRunEmbed(run Data, webhook Webhook, examiner User) *discord.Message {
+	author := submitterName(run)
+	examinerName := examiner.Data.Names.International
+	if examinerName == "" {
+		examinerName = "Unknown examiner"
+	}
+	embed := discord.Embed{
+		Title:       fmt.Sprintf("Run rejected in %v", run.Game.Data.Names.International),
+		Description: fmt.Sprintf("**%v**'s run in **%v** was rejected.", author, run.Category.Data.Name),
+		Color:       15158332,
+		URL:         run.Weblink,
+		Author: &discord.EmbedAuthor{
+			Name: examinerName,
+			URL:  examiner.Data.Weblink,
+		},
+		Fields: []discord.EmbedField{
+			{Name: "Submitter", Value: author, Inline: true},
+			{Name: "Category", Value: run.Category.Data.Name, Inline: true},
+			{Name: "Reason", Value: run.Status.Reason, Inline: false},
+		},
+	}
+	msg := discord.NewMessage()
+	msg.Embeds = []discord.Embed{embed}
+	if webhook.Verification.Templates.Rejected != "" {
+		msg.SetContentWithRoleMention(webhook.Verification.Templates.Rejected, webhook.Notification.MentionRoleID)
+	}
+	return msg
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/SRCStats/src-webhook-sender/discord"
+)
+
+func TestMergeAllowedMentionsKeepsExistingRoleWhitelist(t *testing.T) {
+	current := &discord.AllowedMentions{Parse: []string{}, Roles: []string{"999"}}
+	override := &discord.AllowedMentions{Parse: []string{}, Users: []string{"111"}}
+
+	merged := mergeAllowedMentions(override, current)
+
+	if len(merged.Roles) != 1 || merged.Roles[0] != "999" {
+		t.Fatalf("expected the role SetContentWithRoleMention whitelisted to survive the override, got %+v", merged.Roles)
+	}
+	if len(merged.Users) != 1 || merged.Users[0] != "111" {
+		t.Fatalf("expected the override's user whitelist to apply, got %+v", merged.Users)
+	}
+}
+
+func TestMergeAllowedMentionsNilCurrentReturnsOverride(t *testing.T) {
+	override := &discord.AllowedMentions{Parse: []string{}, Roles: []string{"999"}}
+
+	merged := mergeAllowedMentions(override, nil)
+
+	if merged != override {
+		t.Fatalf("expected the override to be returned unchanged when there's no current AllowedMentions, got %+v", merged)
+	}
+}
+
+func TestMergeAllowedMentionsDedupesSharedIDs(t *testing.T) {
+	current := &discord.AllowedMentions{Parse: []string{}, Roles: []string{"999"}}
+	override := &discord.AllowedMentions{Parse: []string{}, Roles: []string{"999", "111"}}
+
+	merged := mergeAllowedMentions(override, current)
+
+	sort.Strings(merged.Roles)
+	if !reflect.DeepEqual(merged.Roles, []string{"111", "999"}) {
+		t.Fatalf("expected overlapping role IDs to be deduped, got %+v", merged.Roles)
+	}
+}
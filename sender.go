@@ -6,32 +6,54 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"math"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/SRCStats/src-webhook-sender/discord"
 	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/time/rate"
 )
 
 var (
-	database   string
-	collection string
-	wg         sync.WaitGroup
-	cS         SpeedrunClient
-	cD         DiscordClient
+	database     string
+	collection   string
+	wg           sync.WaitGroup
+	cS           SpeedrunClient
+	cD           DiscordClient
+	dedupe       *Dedupe
+	mongoClient  *mongo.Client
+	webhookStore *WebhookStore
+)
+
+const shutdownTimeoutEnv = "SRC_WEBHOOK_SHUTDOWN_TIMEOUT_SECONDS"
+
+const (
+	discordMaxRetries  = 5
+	discordBackoffBase = time.Second
+	discordBackoffCap  = 60 * time.Second
 )
 
 type DiscordClient struct {
 	client  *http.Client
 	limiter *rate.Limiter
+
+	bucketsMu  sync.Mutex
+	buckets    map[string]time.Time // webhook URL -> earliest time we may send to it again
+	retryCount int64                // atomic: retry attempts after a 429/5xx
+	queueDepth int64                // atomic: deliveries currently backing off before a retry
 }
 
 type SpeedrunClient struct {
@@ -46,18 +68,29 @@ const (
 )
 
 type Webhook struct {
-	WebhookUrl string `json:"WebhookUrl,omitempty"`
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	WebhookUrl string             `json:"WebhookUrl,omitempty"`
 	Records    struct {
 		Categories []string `json:"Categories,omitempty"`
 		Users      []string `json:"Users,omitempty"`
 		Events     string   `json:"Events,omitempty"`
 	}
 	Verification struct {
-		Context string   `json:"Context,omitempty"`
-		IDs     []string `json:"IDs,omitempty"`
-		Events  []string `json:"Events,omitempty"`
+		Context   string   `json:"Context,omitempty"`
+		IDs       []string `json:"IDs,omitempty"`
+		Events    []string `json:"Events,omitempty"`
+		Templates struct {
+			New      string `json:"New,omitempty"`
+			Rejected string `json:"Rejected,omitempty"`
+		} `json:"Templates,omitempty"`
+	}
+	Notification struct {
+		ContentTemplate string                   `json:"ContentTemplate,omitempty"`
+		MentionRoleID   string                   `json:"MentionRoleID,omitempty"`
+		AllowedMentions *discord.AllowedMentions `json:"AllowedMentions,omitempty"`
 	}
-	PlayerIndex int `json:"PlayerIndex,omitempty"`
+	PlayerIndex int  `json:"PlayerIndex,omitempty"`
+	Disabled    bool `json:"Disabled,omitempty"`
 }
 
 type Data struct {
@@ -91,6 +124,9 @@ type Data struct {
 				Trophy4th struct {
 					URI string `json:"uri,omitempty"`
 				} `json:"trophy-4th,omitempty"`
+				CoverLarge struct {
+					URI string `json:"uri,omitempty"`
+				} `json:"cover-large,omitempty"`
 			} `json:"assets,omitempty"`
 		} `json:"data,omitempty"`
 	} `json:"game,omitempty"`
@@ -202,6 +238,9 @@ type Response struct {
 }
 
 func (c *SpeedrunClient) Do(req *http.Request) (*http.Response, error) {
+	if req == nil {
+		return nil, fmt.Errorf("nil request")
+	}
 	ctx := context.Background()
 	err := c.limiter.Wait(ctx)
 	if err != nil {
@@ -214,17 +253,96 @@ func (c *SpeedrunClient) Do(req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
+// Do posts body to webhookUrl, honoring any rate-limit bucket Discord has
+// previously told us about for that URL and retrying with exponential
+// backoff on 429/5xx responses, up to discordMaxRetries times.
 func (c *DiscordClient) Do(webhookUrl string, body []byte) (*http.Response, error) {
 	ctx := context.Background()
-	err := c.limiter.Wait(ctx)
-	if err != nil {
-		return nil, err
+	var res *http.Response
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForBucket(ctx, webhookUrl); err != nil {
+			return nil, err
+		}
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewBuffer(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		r, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		res = r
+		c.recordBucket(webhookUrl, res)
+		if (res.StatusCode != http.StatusTooManyRequests && res.StatusCode < 500) || attempt >= discordMaxRetries {
+			return res, nil
+		}
+		atomic.AddInt64(&c.retryCount, 1)
+		atomic.AddInt64(&c.queueDepth, 1)
+		res.Body.Close()
+		time.Sleep(discordBackoff(attempt))
+		atomic.AddInt64(&c.queueDepth, -1)
 	}
-	res, err := http.Post(webhookUrl, "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
+}
+
+// waitForBucket blocks until any previously-recorded rate-limit window for
+// webhookUrl has passed.
+func (c *DiscordClient) waitForBucket(ctx context.Context, webhookUrl string) error {
+	c.bucketsMu.Lock()
+	resetAt, ok := c.buckets[webhookUrl]
+	c.bucketsMu.Unlock()
+	if !ok {
+		return nil
+	}
+	wait := time.Until(resetAt)
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recordBucket remembers how long webhookUrl is rate-limited for, from
+// Discord's X-RateLimit-Reset-After (sent on every response) or Retry-After
+// (sent on 429s), so the next Do for the same URL waits instead of getting
+// rejected again.
+func (c *DiscordClient) recordBucket(webhookUrl string, res *http.Response) {
+	seconds := res.Header.Get("X-RateLimit-Reset-After")
+	if res.StatusCode == http.StatusTooManyRequests {
+		if retryAfter := res.Header.Get("Retry-After"); retryAfter != "" {
+			seconds = retryAfter
+		}
+	}
+	if seconds == "" {
+		return
 	}
-	return res, nil
+	delaySeconds, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || delaySeconds <= 0 {
+		return
+	}
+	resetAt := time.Now().Add(time.Duration(delaySeconds * float64(time.Second)))
+	c.bucketsMu.Lock()
+	c.buckets[webhookUrl] = resetAt
+	c.bucketsMu.Unlock()
+}
+
+// discordBackoff returns the delay before retry attempt, doubling each time
+// from discordBackoffBase up to discordBackoffCap, plus up to 50% jitter to
+// avoid every retry landing on the same tick.
+func discordBackoff(attempt int) time.Duration {
+	backoff := discordBackoffBase * time.Duration(1<<uint(attempt))
+	if backoff > discordBackoffCap {
+		backoff = discordBackoffCap
+	}
+	jitter := time.Duration(rand.Int63n(int64(backoff) / 2))
+	return backoff + jitter
 }
 
 func NewSClient(r *rate.Limiter) *SpeedrunClient {
@@ -245,83 +363,159 @@ func NewDClient(r *rate.Limiter) *DiscordClient {
 	c := &DiscordClient{
 		client:  &cl,
 		limiter: r,
+		buckets: make(map[string]time.Time),
 	}
 	return c
 }
 
 func main() {
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+
 	listenAddr := ":8080"
 	if val, ok := os.LookupEnv("FUNCTIONS_CUSTOMHANDLER_PORT"); ok {
 		listenAddr = ":" + val
 	}
 	rS, rD := rate.NewLimiter(rate.Every(1*time.Minute), 33), rate.NewLimiter(rate.Every(3*time.Second), 5)
 	cS, cD = *NewSClient(rS), *NewDClient(rD)
-	http.HandleFunc("/api/SendWebhook", runsHandler)
-	log.Printf("About to listen on %s. Go to https://127.0.0.1%s/", listenAddr, listenAddr)
-	log.Fatal(http.ListenAndServe(listenAddr, nil))
+
+	startupCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	if err := InitMongo(startupCtx); err != nil {
+		logrus.WithError(err).Fatal("connecting to mongo")
+	}
+
+	dedupe = NewDedupe()
+	if err := EnsureSentRunsIndexes(startupCtx); err != nil {
+		logrus.WithError(err).Error("ensuring sent-runs indexes")
+	}
+	if err := dedupe.LoadFromMongo(startupCtx); err != nil {
+		logrus.WithError(err).Error("loading dedupe bloom filter from Mongo")
+	}
+
+	webhookStore = NewWebhookStore()
+	if err := webhookStore.Rebuild(startupCtx); err != nil {
+		logrus.WithError(err).Error("initial webhook store load")
+	}
+	cancel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/SendWebhook", runsHandler)
+	mux.HandleFunc("/api/RebuildBloom", rebuildBloomHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	srv := &http.Server{Addr: listenAddr, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go webhookStore.Watch(ctx, 5*time.Minute)
+
+	go func() {
+		logrus.Infof("About to listen on %s. Go to https://127.0.0.1%s/", listenAddr, listenAddr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Error("HTTP server stopped unexpectedly")
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	logrus.Info("Shutdown signal received, draining in-flight work")
+
+	shutdownTimeout := 30 * time.Second
+	if val, ok := os.LookupEnv(shutdownTimeoutEnv); ok {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			shutdownTimeout = time.Duration(seconds) * time.Second
+		}
+	}
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logrus.WithError(err).Error("shutting down HTTP server")
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		logrus.Info("All in-flight webhook deliveries drained cleanly")
+	case <-shutdownCtx.Done():
+		logrus.Warn("Timed out waiting for in-flight webhook deliveries to drain")
+	}
+
+	if err := mongoClient.Disconnect(context.Background()); err != nil {
+		logrus.WithError(err).Error("disconnecting mongo client")
+	}
 }
 
 func runsHandler(w http.ResponseWriter, r *http.Request) {
-	// todo: handle invalid bodies
-
-	body := r.Body
-	defer body.Close()
-	b, err := io.ReadAll(body)
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
 	if err != nil {
-		log.Fatal(err)
+		logrus.WithError(err).Error("reading run payload body")
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
 	}
 	var data []Data
-	err = json.Unmarshal(b, &data)
-	if err != nil {
-		log.Fatal(err)
+	if err := json.Unmarshal(b, &data); err != nil {
+		logrus.WithError(err).Error("unmarshalling run payload")
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
 	}
-	webhooks := GetWebhooks()
 	switch data[0].Status.Status {
 	case "verified":
-		HandleVerified(&data, &webhooks)
+		HandleVerified(&data)
 	case "new":
-		break
+		webhooks := webhookStore.All()
+		HandleNew(&data, &webhooks)
 	case "rejected":
-		break
+		webhooks := webhookStore.All()
+		HandleRejected(&data, &webhooks)
 	}
-	w.WriteHeader(200)
+	w.WriteHeader(http.StatusOK)
 }
 
-func HandleVerified(data *[]Data, webhooks *[]Webhook) {
+func HandleVerified(data *[]Data) {
 	wg.Add(1)
 	for _, run := range *data {
 		webhooksToSend := make(map[string]Webhook)
-	nextWebhook:
-		for _, webhook := range *webhooks {
-			for _, category := range webhook.Records.Categories {
-				if category == run.Category.Data.ID {
-					// this is handling for a guest player as the first player, we don't want to send a webhook for that
-					if run.Players.Data[0].Names.International != "" {
-						webhook.PlayerIndex = 0
-						webhooksToSend[webhook.WebhookUrl] = webhook
-						continue nextWebhook
-					}
-				}
+		if run.Players.Data[0].Names.International != "" {
+			// this is handling for a guest player as the first player, we don't want to send a webhook for that
+			for _, webhook := range webhookStore.ForCategory(run.Category.Data.ID) {
+				webhook.PlayerIndex = 0
+				webhooksToSend[webhook.WebhookUrl] = webhook
 			}
-			for i, player := range run.Players.Data {
-				for _, wPlayer := range webhook.Records.Users {
-					if wPlayer == player.ID {
-						webhook.PlayerIndex = i
-						webhooksToSend[webhook.WebhookUrl] = webhook
-						continue nextWebhook
-					}
+		}
+		for i, player := range run.Players.Data {
+			for _, webhook := range webhookStore.ForUser(player.ID) {
+				if _, alreadyMatched := webhooksToSend[webhook.WebhookUrl]; alreadyMatched {
+					continue
 				}
+				webhook.PlayerIndex = i
+				webhooksToSend[webhook.WebhookUrl] = webhook
+			}
+		}
+		for url := range webhooksToSend {
+			if dedupe.AlreadySent(context.Background(), run.ID, url) {
+				logrus.WithFields(logrus.Fields{"run_id": run.ID, "webhook_url": url}).Info("run already sent to webhook, skipping redelivery")
+				delete(webhooksToSend, url)
 			}
 		}
 		if len(webhooksToSend) > 0 {
 			wg.Add(1)
-			go SendWebhook(&webhooksToSend, run, "verified")
+			go SendWebhook(&webhooksToSend, run, "verified", User{})
 		}
 	}
 	wg.Done()
 }
 
-func SendWebhook(webhooks *map[string]Webhook, run Data, scope string) {
+func SendWebhook(webhooks *map[string]Webhook, run Data, scope string, examiner User) {
 	// todo: add handling for multiple webhooks wanting the same run
 	switch scope {
 	case "verified":
@@ -389,43 +583,22 @@ func SendWebhook(webhooks *map[string]Webhook, run Data, scope string) {
 		if runTime == "" {
 			runTime = "0s"
 		}
-		fields := []map[string]interface{}{
-			{
-				"name":   "Category",
-				"value":  category,
-				"inline": true,
-			},
-			{
-				"name":   "Time",
-				"value":  runTime,
-				"inline": true,
+		fieldsEmbed := discord.Embed{
+			Fields: []discord.EmbedField{
+				{Name: "Category", Value: category, Inline: true},
+				{Name: "Time", Value: runTime, Inline: true},
 			},
 		}
 		if players != "" {
-			fields = append([]map[string]interface{}{
-				{
-					"name":   "Players",
-					"value":  players,
-					"inline": true,
-				},
-			}, fields...)
+			fieldsEmbed.PrependField(discord.EmbedField{Name: "Players", Value: players, Inline: true})
 		}
 		if variables != "" {
-			fields = append(fields, map[string]interface{}{
-				"name":   "Variables",
-				"value":  variables,
-				"inline": true,
-			})
+			fieldsEmbed.Fields = append(fieldsEmbed.Fields, discord.EmbedField{Name: "Variables", Value: variables, Inline: true})
 		}
 		if run.Level.Data.Name != "" {
-			fields = append([]map[string]interface{}{
-				{
-					"name":   "Level",
-					"value":  run.Level.Data.Name,
-					"inline": true,
-				},
-			}, fields...)
+			fieldsEmbed.PrependField(discord.EmbedField{Name: "Level", Value: run.Level.Data.Name, Inline: true})
 		}
+		fields := fieldsEmbed.Fields
 		userPBs := make(map[int]PBs)
 		for _, webhook := range *webhooks {
 			wg.Add(1)
@@ -474,140 +647,109 @@ func SendWebhook(webhooks *map[string]Webhook, run Data, scope string) {
 				} else {
 					author = run.Players.Data[playerIndex].Names.International
 				}
-				embeds := []map[string]interface{}{
-					{
-						"author": map[string]interface{}{
-							"name":     run.Players.Data[playerIndex].Names.International,
-							"url":      run.Players.Data[playerIndex].Weblink,
-							"icon_url": run.Players.Data[playerIndex].Assets.Image.URI,
-						},
-						"color":  "15899392",
-						"fields": fields,
-						"url":    run.Weblink,
+				embed := discord.Embed{
+					Author: &discord.EmbedAuthor{
+						Name:    run.Players.Data[playerIndex].Names.International,
+						URL:     run.Players.Data[playerIndex].Weblink,
+						IconURL: run.Players.Data[playerIndex].Assets.Image.URI,
 					},
+					Color:  15899392,
+					Fields: fields,
+					URL:    run.Weblink,
+				}
+				if run.Game.Data.Assets.CoverLarge.URI != "" {
+					embed.Thumbnail = &discord.EmbedThumbnail{URL: run.Game.Data.Assets.CoverLarge.URI}
 				}
 				if place != "" && isPb {
-					embeds[0]["footer"] = map[string]interface{}{
-						"text":     fmt.Sprintf("They're now %v place!", place),
-						"icon_url": iconUrl,
+					embed.Footer = &discord.EmbedFooter{
+						Text:    fmt.Sprintf("They're now %v place!", place),
+						IconURL: iconUrl,
 					}
 				}
 				if place == "1st" {
-					embeds[0]["title"] = fmt.Sprintf("New world record in %v in %v!", category, run.Game.Data.Names.International)
-					embeds[0]["description"] = fmt.Sprintf("**%v** got a new world record in **%v**!", author, run.Game.Data.Names.International)
+					embed.Title = fmt.Sprintf("New world record in %v in %v!", category, run.Game.Data.Names.International)
+					embed.Description = fmt.Sprintf("**%v** got a new world record in **%v**!", author, run.Game.Data.Names.International)
 				} else if isPb {
-					embeds[0]["title"] = fmt.Sprintf("New personal best by %v!", author)
-					embeds[0]["description"] = fmt.Sprintf("**%v** got a new personal best in **%v**!", author, run.Game.Data.Names.International)
+					embed.Title = fmt.Sprintf("New personal best by %v!", author)
+					embed.Description = fmt.Sprintf("**%v** got a new personal best in **%v**!", author, run.Game.Data.Names.International)
 				} else {
-					embeds[0]["title"] = fmt.Sprintf("New run by %v!", author)
-					embeds[0]["description"] = fmt.Sprintf("**%v** submitted a new run in **%v**!", author, run.Game.Data.Names.International)
+					embed.Title = fmt.Sprintf("New run by %v!", author)
+					embed.Description = fmt.Sprintf("**%v** submitted a new run in **%v**!", author, run.Game.Data.Names.International)
 				}
-				jsonBody := map[string]interface{}{
-					"content":     nil,
-					"embeds":      embeds,
-					"attachments": nil,
+				msg := discord.NewMessage()
+				msg.Embeds = []discord.Embed{embed}
+				var vodUrl string
+				if len(run.Videos.Links) > 0 {
+					vodUrl = run.Videos.Links[0].URI
 				}
-				body, err := json.Marshal(jsonBody)
-				if err != nil {
-					log.Printf("Error while marshalling webhook body!\n%v", err)
+				leaderboardUrl := fmt.Sprintf("https://www.speedrun.com/%v#%v", run.Game.Data.Abbreviation, run.Category.Data.ID)
+				buttons := discord.LinkButtons(
+					discord.ComponentButton{Label: "Watch VOD", URL: vodUrl},
+					discord.ComponentButton{Label: "View Run", URL: run.Weblink},
+					discord.ComponentButton{Label: "Leaderboard", URL: leaderboardUrl},
+				)
+				if len(buttons.Components) > 0 {
+					msg.Components = []discord.ComponentRow{buttons}
 				}
-				res, err := cD.Do(webhook.WebhookUrl, body)
-				if err != nil {
-					log.Printf("Error while sending webhook!\n%v", err)
-				}
-				if res.StatusCode == 404 {
-					log.Printf("Webhook %v is not found!", webhook.WebhookUrl)
-					DeleteWebhook(webhook)
-				}
-				if res.StatusCode == 429 {
-					log.Printf("Webhook %v is over rate limit!", webhook.WebhookUrl)
+				if webhook.Notification.ContentTemplate != "" {
+					msg.SetContentWithRoleMention(webhook.Notification.ContentTemplate, webhook.Notification.MentionRoleID)
 				}
+				deliverMessage(webhook, run.ID, msg)
 				wg.Done()
 			}(webhook, webhook.PlayerIndex)
 		}
 	case "new":
-		break
+		for _, webhook := range *webhooks {
+			wg.Add(1)
+			go func(webhook Webhook) {
+				deliverMessage(webhook, run.ID, newRunEmbed(run, webhook))
+				wg.Done()
+			}(webhook)
+		}
 	case "rejected":
-		break
+		for _, webhook := range *webhooks {
+			wg.Add(1)
+			go func(webhook Webhook) {
+				deliverMessage(webhook, run.ID, rejectedRunEmbed(run, webhook, examiner))
+				wg.Done()
+			}(webhook)
+		}
 	}
 	wg.Done()
 }
 
-func Connect() *mongo.Client {
-	connectionString := os.Getenv(connectionStringEnv)
-	if connectionString == "" {
-		log.Fatal("The database connection string variable is missing!")
-	}
-	database = os.Getenv(databaseNameEnv)
-	if database == "" {
-		log.Fatal("The database name variable is missing!")
-	}
-	collection = "webhook-list"
-	if collection == "" {
-		log.Fatal("The collection name variable is missing!")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
-	options := options.Client().ApplyURI(connectionString).SetDirect(true)
-	c, _ := mongo.NewClient(options)
-
-	err := c.Connect(ctx)
-	if err != nil {
-		log.Fatalf("Connection couldn't be initialized!\n%v", err)
-	}
-	err = c.Ping(ctx, nil)
-	if err != nil {
-		log.Fatalf("Connection didn't respond back!\n%v", err)
-	}
-	return c
-}
-
-func GetWebhooks() []Webhook {
-	c := Connect()
-	defer c.Disconnect(context.TODO())
-	collection := c.Database(database).Collection(collection)
+func DeleteWebhook(webhook Webhook) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	var webhooks []Webhook
-	cur, err := collection.Find(ctx, bson.D{})
+	coll := mongoClient.Database(database).Collection(collection)
+	result, err := coll.DeleteOne(ctx, bson.M{"WebhookUrl": webhook.WebhookUrl})
 	if err != nil {
-		log.Fatalf("Error while finding webhooks!\n%v", err)
-	}
-	defer cur.Close(ctx)
-	for cur.Next(ctx) {
-		var result Webhook
-		err := cur.Decode(&result)
-		if err != nil {
-			log.Fatalf("Error while decoding webhooks!\n%v", err)
-		}
-		webhooks = append(webhooks, result)
-	}
-	if err := cur.Err(); err != nil {
-		log.Fatalf("Error while iterating webhooks!\n%v", err)
+		return fmt.Errorf("deleting webhook: %w", err)
 	}
-	return webhooks
+	logrus.WithFields(logrus.Fields{"webhook_url": webhook.WebhookUrl, "deleted_count": result.DeletedCount}).Info("deleted disabled webhook")
+	return nil
 }
 
-func DeleteWebhook(webhook Webhook) {
-	c := Connect()
-	defer c.Disconnect(context.TODO())
-	collection := c.Database(database).Collection(collection)
+// MarkWebhookDisabled flags webhook as disabled rather than deleting it, for
+// responses (401/403) that mean the webhook's auth was revoked but the
+// document may still hold state worth keeping around for the owner.
+func MarkWebhookDisabled(webhook Webhook) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	result, err := collection.DeleteOne(ctx, bson.M{"WebhookUrl": webhook.WebhookUrl})
+	coll := mongoClient.Database(database).Collection(collection)
+	result, err := coll.UpdateOne(ctx, bson.M{"WebhookUrl": webhook.WebhookUrl}, bson.M{"$set": bson.M{"Disabled": true}})
 	if err != nil {
-		log.Printf("Error while deleting webhook!\n%v", err)
+		return fmt.Errorf("disabling webhook: %w", err)
 	}
-	log.Printf("Deleted %v webhook with url %v", result.DeletedCount, webhook.WebhookUrl)
+	logrus.WithFields(logrus.Fields{"webhook_url": webhook.WebhookUrl, "matched_count": result.MatchedCount}).Info("disabled webhook after auth failure")
+	return nil
 }
 
 func GetPersonalBests(user string, game string) PBs {
 	queryFrag := fmt.Sprintf("/users/%v/personal-bests?game=%v&vary=%v", user, game, time.Now().Nanosecond())
 	r, err := cS.Do(createReq(queryFrag))
 	if err != nil {
-		log.Printf("Error while getting leaderboard!\n%v", err)
+		logrus.WithError(err).Error("getting personal bests")
 	}
 	return parseResPBs(r)
 }
@@ -616,7 +758,8 @@ func createReq(queries string) *http.Request {
 	url := "https://speedrun.com/api/v1"
 	req, err := http.NewRequest("GET", url+queries, nil)
 	if err != nil {
-		log.Panic(err)
+		logrus.WithError(err).Error("building speedrun.com request")
+		return nil
 	}
 	req.Header.Add("User-Agent", "SRCStats Webhook")
 	return req
@@ -628,10 +771,13 @@ func parseResPBs(r *http.Response) PBs {
 	}
 	result, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Panic(err)
+		logrus.WithError(err).Error("reading personal bests response")
+		return PBs{}
 	}
 	r.Body.Close()
 	var res PBs
-	json.Unmarshal(result, &res)
+	if err := json.Unmarshal(result, &res); err != nil {
+		logrus.WithError(err).Error("unmarshalling personal bests response")
+	}
 	return res
 }
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestDiscordBackoffDoublesWithinBounds(t *testing.T) {
+	for attempt := 0; attempt <= discordMaxRetries; attempt++ {
+		backoff := discordBackoff(attempt)
+		if backoff < discordBackoffBase {
+			t.Fatalf("attempt %d: backoff %v is below the base %v", attempt, backoff, discordBackoffBase)
+		}
+		maxWithJitter := discordBackoffCap + discordBackoffCap/2
+		if backoff > maxWithJitter {
+			t.Fatalf("attempt %d: backoff %v exceeds the cap plus jitter %v", attempt, backoff, maxWithJitter)
+		}
+		expected := discordBackoffBase << uint(attempt)
+		if expected > discordBackoffCap {
+			expected = discordBackoffCap
+		}
+		if backoff < expected || backoff > expected+expected/2 {
+			t.Fatalf("attempt %d: expected backoff within [%v, %v], got %v", attempt, expected, expected+expected/2, backoff)
+		}
+	}
+}
+
+func TestDiscordBackoffCapsAtHighAttempts(t *testing.T) {
+	backoff := discordBackoff(20)
+	maxWithJitter := discordBackoffCap + discordBackoffCap/2
+	if backoff < discordBackoffCap || backoff > maxWithJitter {
+		t.Fatalf("expected a high attempt count to stay within [cap, cap*1.5], got %v", backoff)
+	}
+}
+
+func TestDiscordBackoffFirstAttemptIsBaseWithJitter(t *testing.T) {
+	backoff := discordBackoff(0)
+	if backoff < discordBackoffBase || backoff > discordBackoffBase+discordBackoffBase/2 {
+		t.Fatalf("expected attempt 0 to be base plus up to 50%% jitter, got %v", backoff)
+	}
+}
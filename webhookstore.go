@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InitMongo connects the package-level mongoClient once at startup. Every
+// other function in the package reuses it instead of opening its own
+// connection per call.
+func InitMongo(ctx context.Context) error {
+	connectionString := os.Getenv(connectionStringEnv)
+	if connectionString == "" {
+		return fmt.Errorf("missing required env var %s", connectionStringEnv)
+	}
+	database = os.Getenv(databaseNameEnv)
+	if database == "" {
+		return fmt.Errorf("missing required env var %s", databaseNameEnv)
+	}
+	collection = "webhook-list"
+
+	clientOptions := options.Client().ApplyURI(connectionString).SetDirect(true)
+	c, err := mongo.NewClient(clientOptions)
+	if err != nil {
+		return fmt.Errorf("creating mongo client: %w", err)
+	}
+	if err := c.Connect(ctx); err != nil {
+		return fmt.Errorf("connecting to mongo: %w", err)
+	}
+	if err := c.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("pinging mongo: %w", err)
+	}
+	mongoClient = c
+	return nil
+}
+
+func fetchWebhooks(ctx context.Context) ([]Webhook, error) {
+	coll := mongoClient.Database(database).Collection(collection)
+	var webhooks []Webhook
+	cur, err := coll.Find(ctx, bson.M{"Disabled": bson.M{"$ne": true}})
+	if err != nil {
+		return nil, fmt.Errorf("finding webhooks: %w", err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var result Webhook
+		if err := cur.Decode(&result); err != nil {
+			return nil, fmt.Errorf("decoding webhook: %w", err)
+		}
+		webhooks = append(webhooks, result)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, fmt.Errorf("iterating webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// WebhookStore is an in-memory index over the webhook-list collection, keyed
+// by category ID and user ID so HandleVerified can look up matching webhooks
+// in O(1) instead of scanning every webhook for every run. It's kept fresh
+// by Watch.
+type WebhookStore struct {
+	mu         sync.RWMutex
+	byCategory map[string][]Webhook
+	byUser     map[string][]Webhook
+	byID       map[primitive.ObjectID]Webhook
+	all        []Webhook
+}
+
+func NewWebhookStore() *WebhookStore {
+	return &WebhookStore{
+		byCategory: make(map[string][]Webhook),
+		byUser:     make(map[string][]Webhook),
+		byID:       make(map[primitive.ObjectID]Webhook),
+	}
+}
+
+// Rebuild re-fetches every webhook from Mongo and atomically swaps in freshly
+// built index buckets. main calls this once at startup; Watch calls it again
+// whenever it can't decode a change-stream event, and on every tick once it
+// has fallen back to polling.
+func (s *WebhookStore) Rebuild(ctx context.Context) error {
+	webhooks, err := fetchWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching webhooks: %w", err)
+	}
+	byCategory := make(map[string][]Webhook)
+	byUser := make(map[string][]Webhook)
+	byID := make(map[primitive.ObjectID]Webhook, len(webhooks))
+	for _, webhook := range webhooks {
+		for _, category := range webhook.Records.Categories {
+			byCategory[category] = append(byCategory[category], webhook)
+		}
+		for _, user := range webhook.Records.Users {
+			byUser[user] = append(byUser[user], webhook)
+		}
+		byID[webhook.ID] = webhook
+	}
+	s.mu.Lock()
+	s.byCategory = byCategory
+	s.byUser = byUser
+	s.byID = byID
+	s.all = webhooks
+	s.mu.Unlock()
+	return nil
+}
+
+// changeEvent is the subset of a MongoDB change stream event applyChangeEvent
+// needs to patch the index without rescanning the collection. FullDocument is
+// only populated for insert/replace by default and for update too once Watch
+// requests document lookup, so it's nil on delete events.
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *Webhook `bson:"fullDocument"`
+}
+
+// applyChangeEvent patches just the index buckets a single change-stream
+// event affects, instead of rescanning the whole webhook-list collection.
+// It first drops whatever ev's document was previously indexed under (its
+// Records.Categories/Users may have changed between revisions), then, unless
+// the event is a delete or the document is now Disabled, re-adds it under
+// its current keys.
+func (s *WebhookStore) applyChangeEvent(ev changeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.byID[ev.DocumentKey.ID]; ok {
+		s.removeLocked(old)
+		delete(s.byID, ev.DocumentKey.ID)
+	}
+	if ev.OperationType == "delete" || ev.FullDocument == nil || ev.FullDocument.Disabled {
+		return
+	}
+	webhook := *ev.FullDocument
+	s.byID[ev.DocumentKey.ID] = webhook
+	s.addLocked(webhook)
+}
+
+// removeLocked drops webhook's entries from every bucket it was indexed
+// under. Callers must hold s.mu.
+func (s *WebhookStore) removeLocked(webhook Webhook) {
+	for _, category := range webhook.Records.Categories {
+		s.byCategory[category] = removeByURL(s.byCategory[category], webhook.WebhookUrl)
+	}
+	for _, user := range webhook.Records.Users {
+		s.byUser[user] = removeByURL(s.byUser[user], webhook.WebhookUrl)
+	}
+	s.all = removeByURL(s.all, webhook.WebhookUrl)
+}
+
+// addLocked indexes webhook under its current category/user keys. Callers
+// must hold s.mu.
+func (s *WebhookStore) addLocked(webhook Webhook) {
+	for _, category := range webhook.Records.Categories {
+		s.byCategory[category] = append(s.byCategory[category], webhook)
+	}
+	for _, user := range webhook.Records.Users {
+		s.byUser[user] = append(s.byUser[user], webhook)
+	}
+	s.all = append(s.all, webhook)
+}
+
+// removeByURL returns list with every webhook whose WebhookUrl matches url
+// filtered out.
+func removeByURL(list []Webhook, url string) []Webhook {
+	out := make([]Webhook, 0, len(list))
+	for _, webhook := range list {
+		if webhook.WebhookUrl != url {
+			out = append(out, webhook)
+		}
+	}
+	return out
+}
+
+func (s *WebhookStore) ForCategory(categoryID string) []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Webhook(nil), s.byCategory[categoryID]...)
+}
+
+func (s *WebhookStore) ForUser(userID string) []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Webhook(nil), s.byUser[userID]...)
+}
+
+// All returns every known webhook, for the scopes (new/rejected) that match
+// on Verification.Context/IDs rather than Records.Categories/Users.
+func (s *WebhookStore) All() []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Webhook(nil), s.all...)
+}
+
+// Watch keeps the store fresh off a change stream on the webhook-list
+// collection, atomically patching just the index buckets each
+// insert/update/delete/replace event affects via applyChangeEvent. Update
+// lookup is requested so update events carry FullDocument too, not just
+// insert/replace. If an event can't be decoded, Watch falls back to a full
+// Rebuild for that event rather than risk a stale index. If change streams
+// aren't available (e.g. a standalone, non-replica-set Mongo deployment), or
+// the stream ever ends, it falls back to polling every pollInterval instead.
+func (s *WebhookStore) Watch(ctx context.Context, pollInterval time.Duration) {
+	coll := mongoClient.Database(database).Collection(collection)
+	streamOpts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	stream, err := coll.Watch(ctx, mongo.Pipeline{}, streamOpts)
+	if err != nil {
+		logrus.WithError(err).Warn("starting webhook-list change stream, falling back to polling")
+		s.pollLoop(ctx, pollInterval)
+		return
+	}
+	defer stream.Close(ctx)
+	for stream.Next(ctx) {
+		var ev changeEvent
+		if err := stream.Decode(&ev); err != nil {
+			logrus.WithError(err).Error("decoding webhook-list change event, falling back to a full rebuild")
+			if err := s.Rebuild(ctx); err != nil {
+				logrus.WithError(err).Error("rebuilding webhook store from change stream event")
+			}
+			continue
+		}
+		s.applyChangeEvent(ev)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err := stream.Err(); err != nil {
+		logrus.WithError(err).Error("webhook-list change stream ended, falling back to polling")
+	}
+	s.pollLoop(ctx, pollInterval)
+}
+
+func (s *WebhookStore) pollLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Rebuild(ctx); err != nil {
+				logrus.WithError(err).Error("polling webhook store rebuild")
+			}
+		}
+	}
+}